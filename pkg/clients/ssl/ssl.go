@@ -18,6 +18,8 @@ limitations under the License.
 package ssl
 
 import (
+	nethttp "net/http"
+
 	"golang.org/x/oauth2"
 	compute "google.golang.org/api/compute/v0.beta"
 
@@ -26,11 +28,13 @@ import (
 )
 
 const (
-	typeManaged = "MANAGED"
+	typeManaged     = "MANAGED"
+	typeSelfManaged = "SELF_MANAGED"
 )
 
 type Ssl interface {
 	Create(name string, domains []string) error
+	CreateSelfManaged(name, certificate, privateKey string) error
 	Delete(name string) error
 	Exists(name string) (bool, error)
 	Get(name string) (*compute.SslCertificate, error)
@@ -43,6 +47,12 @@ type sslImpl struct {
 
 func New(config *config.Config) (Ssl, error) {
 	client := oauth2.NewClient(oauth2.NoContext, config.Compute.TokenSource)
+	if config.Compute.TLSConfig != nil {
+		client.Transport = &oauth2.Transport{
+			Base:   &nethttp.Transport{TLSClientConfig: config.Compute.TLSConfig},
+			Source: config.Compute.TokenSource,
+		}
+	}
 	client.Timeout = config.Compute.Timeout
 
 	service, err := compute.New(client)
@@ -70,6 +80,21 @@ func (s sslImpl) Create(name string, domains []string) error {
 	return err
 }
 
+// CreateSelfManaged creates a new SslCertificate resource from a user-provided certificate and private key.
+func (s sslImpl) CreateSelfManaged(name, certificate, privateKey string) error {
+	sslCertificate := &compute.SslCertificate{
+		SelfManaged: &compute.SslCertificateSelfManagedSslCertificate{
+			Certificate: certificate,
+			PrivateKey:  privateKey,
+		},
+		Name: name,
+		Type: typeSelfManaged,
+	}
+
+	_, err := s.service.Insert(s.projectID, sslCertificate).Do()
+	return err
+}
+
 // Delete deletes an SslCertificate resource.
 func (s sslImpl) Delete(name string) error {
 	_, err := s.service.Delete(s.projectID, name).Do()
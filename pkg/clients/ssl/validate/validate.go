@@ -0,0 +1,169 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package validate inspects an SslCertificate fetched from GCE and reports problems that
+// would otherwise only show up as a raw status string on the ManagedCertificate.
+package validate
+
+import (
+	"fmt"
+	"time"
+
+	compute "google.golang.org/api/compute/v0.beta"
+)
+
+const (
+	// ReasonEmptyResponse is reported when Validate is given a nil SslCertificate, or one whose
+	// ExpireTime cannot be parsed as RFC3339.
+	ReasonEmptyResponse = "EmptyResponse"
+	// ReasonNoDomains is reported when an SslCertificate has no domains at all.
+	ReasonNoDomains = "NoDomains"
+	// ReasonExpired is reported when ExpireTime is in the past.
+	ReasonExpired = "Expired"
+	// ReasonExpiringSoon is reported when ExpireTime falls within the configured renewal window.
+	ReasonExpiringSoon = "ExpiringSoon"
+	// ReasonDomainDrift is reported when the spec domains and Managed.Domains disagree.
+	ReasonDomainDrift = "DomainDrift"
+	// ReasonProvisioningTimeout is reported when a domain status is stuck in PROVISIONING
+	// past the configured timeout.
+	ReasonProvisioningTimeout = "ProvisioningTimeout"
+
+	domainStatusProvisioning = "PROVISIONING"
+)
+
+// ValidationError describes a single problem found with an SslCertificate.
+type ValidationError struct {
+	// Reason is one of the Reason* constants, suitable for use as a Kubernetes Event reason.
+	Reason string
+	// Message is a human readable description of the problem.
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Message)
+}
+
+// Options configures the thresholds Validate checks against.
+type Options struct {
+	// RenewalWindow is how far ahead of ExpireTime a certificate is reported as expiring soon.
+	RenewalWindow time.Duration
+	// ProvisioningTimeout is how long a domain may stay in PROVISIONING before being flagged.
+	ProvisioningTimeout time.Duration
+	// SpecDomains are the domains declared on the ManagedCertificate spec, checked against
+	// Managed.Domains for drift. A nil slice skips the drift check.
+	SpecDomains []string
+	// DomainProvisioningSince records, for domains the caller has seen stuck in
+	// PROVISIONING before, the time that status was first observed. Validate has no way to
+	// derive this itself since SslCertificate carries no history; callers that want the
+	// ReasonProvisioningTimeout check populate it from their own tracking.
+	DomainProvisioningSince map[string]time.Time
+	// Now is the time Validate treats as "now"; defaults to time.Now() when zero.
+	Now time.Time
+}
+
+// Validate checks cert against opts and returns one ValidationError per problem found. A nil
+// or empty slice means no problems were found.
+func Validate(cert *compute.SslCertificate, opts Options) []ValidationError {
+	if cert == nil {
+		return []ValidationError{{Reason: ReasonEmptyResponse, Message: "SslCertificate response was nil"}}
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var errs []ValidationError
+
+	switch {
+	case cert.Managed != nil:
+		if len(cert.Managed.Domains) == 0 {
+			errs = append(errs, ValidationError{Reason: ReasonNoDomains, Message: "SslCertificate has no domains"})
+		}
+
+		if opts.SpecDomains != nil && !sameDomains(opts.SpecDomains, cert.Managed.Domains) {
+			errs = append(errs, ValidationError{
+				Reason:  ReasonDomainDrift,
+				Message: fmt.Sprintf("Spec domains %v do not match SslCertificate domains %v", opts.SpecDomains, cert.Managed.Domains),
+			})
+		}
+	case cert.SelfManaged != nil:
+		// Self-managed certificates carry no domain list or per-domain status on the GCE
+		// resource itself, so there's nothing to check here: domain and drift validation
+		// only applies to MANAGED certificates.
+	default:
+		errs = append(errs, ValidationError{Reason: ReasonNoDomains, Message: "SslCertificate has no domains"})
+	}
+
+	if cert.ExpireTime != "" {
+		expireTime, err := time.Parse(time.RFC3339, cert.ExpireTime)
+		if err != nil {
+			errs = append(errs, ValidationError{
+				Reason:  ReasonEmptyResponse,
+				Message: fmt.Sprintf("Could not parse ExpireTime %q: %v", cert.ExpireTime, err),
+			})
+		} else if !expireTime.After(now) {
+			errs = append(errs, ValidationError{
+				Reason:  ReasonExpired,
+				Message: fmt.Sprintf("SslCertificate expired at %s", cert.ExpireTime),
+			})
+		} else if opts.RenewalWindow > 0 && expireTime.Sub(now) <= opts.RenewalWindow {
+			errs = append(errs, ValidationError{
+				Reason:  ReasonExpiringSoon,
+				Message: fmt.Sprintf("SslCertificate expires at %s, within the %s renewal window", cert.ExpireTime, opts.RenewalWindow),
+			})
+		}
+	}
+
+	if cert.Managed != nil && opts.ProvisioningTimeout > 0 {
+		for domain, status := range cert.Managed.DomainStatus {
+			if status != domainStatusProvisioning {
+				continue
+			}
+
+			since, ok := opts.DomainProvisioningSince[domain]
+			if ok && now.Sub(since) > opts.ProvisioningTimeout {
+				errs = append(errs, ValidationError{
+					Reason:  ReasonProvisioningTimeout,
+					Message: fmt.Sprintf("Domain %s has been PROVISIONING since %s, longer than the %s timeout", domain, since, opts.ProvisioningTimeout),
+				})
+			}
+		}
+	}
+
+	return errs
+}
+
+func sameDomains(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, domain := range a {
+		counts[domain]++
+	}
+	for _, domain := range b {
+		counts[domain]--
+	}
+	for _, count := range counts {
+		if count != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validate
+
+import (
+	"testing"
+	"time"
+
+	compute "google.golang.org/api/compute/v0.beta"
+)
+
+func reasons(errs []ValidationError) []string {
+	var result []string
+	for _, err := range errs {
+		result = append(result, err.Reason)
+	}
+	return result
+}
+
+func hasReason(errs []ValidationError, reason string) bool {
+	for _, err := range errs {
+		if err.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2026, time.July, 25, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		cert       *compute.SslCertificate
+		opts       Options
+		wantReason string
+		wantEmpty  bool
+	}{
+		{
+			name:       "nil response",
+			cert:       nil,
+			opts:       Options{Now: now},
+			wantReason: ReasonEmptyResponse,
+		},
+		{
+			name: "healthy managed certificate",
+			cert: &compute.SslCertificate{
+				Managed: &compute.SslCertificateManagedSslCertificate{
+					Domains: []string{"example.com"},
+				},
+				ExpireTime: now.Add(60 * 24 * time.Hour).Format(time.RFC3339),
+			},
+			opts:      Options{Now: now, RenewalWindow: 30 * 24 * time.Hour},
+			wantEmpty: true,
+		},
+		{
+			name: "managed certificate with no domains",
+			cert: &compute.SslCertificate{
+				Managed: &compute.SslCertificateManagedSslCertificate{},
+			},
+			opts:       Options{Now: now},
+			wantReason: ReasonNoDomains,
+		},
+		{
+			name:       "neither managed nor self-managed is reported as no domains",
+			cert:       &compute.SslCertificate{},
+			opts:       Options{Now: now},
+			wantReason: ReasonNoDomains,
+		},
+		{
+			name: "healthy self-managed certificate is not flagged for domains",
+			cert: &compute.SslCertificate{
+				SelfManaged: &compute.SslCertificateSelfManagedSslCertificate{},
+				ExpireTime:  now.Add(60 * 24 * time.Hour).Format(time.RFC3339),
+			},
+			opts:      Options{Now: now, RenewalWindow: 30 * 24 * time.Hour, SpecDomains: []string{"example.com"}},
+			wantEmpty: true,
+		},
+		{
+			name: "expired certificate",
+			cert: &compute.SslCertificate{
+				Managed: &compute.SslCertificateManagedSslCertificate{
+					Domains: []string{"example.com"},
+				},
+				ExpireTime: now.Add(-time.Hour).Format(time.RFC3339),
+			},
+			opts:       Options{Now: now},
+			wantReason: ReasonExpired,
+		},
+		{
+			name: "certificate expiring within the renewal window",
+			cert: &compute.SslCertificate{
+				Managed: &compute.SslCertificateManagedSslCertificate{
+					Domains: []string{"example.com"},
+				},
+				ExpireTime: now.Add(10 * 24 * time.Hour).Format(time.RFC3339),
+			},
+			opts:       Options{Now: now, RenewalWindow: 30 * 24 * time.Hour},
+			wantReason: ReasonExpiringSoon,
+		},
+		{
+			name: "unparseable ExpireTime",
+			cert: &compute.SslCertificate{
+				Managed: &compute.SslCertificateManagedSslCertificate{
+					Domains: []string{"example.com"},
+				},
+				ExpireTime: "not-a-timestamp",
+			},
+			opts:       Options{Now: now},
+			wantReason: ReasonEmptyResponse,
+		},
+		{
+			name: "spec domains drift from Managed.Domains",
+			cert: &compute.SslCertificate{
+				Managed: &compute.SslCertificateManagedSslCertificate{
+					Domains: []string{"example.com"},
+				},
+			},
+			opts:       Options{Now: now, SpecDomains: []string{"example.com", "other.example.com"}},
+			wantReason: ReasonDomainDrift,
+		},
+		{
+			name: "domain stuck in PROVISIONING past the timeout",
+			cert: &compute.SslCertificate{
+				Managed: &compute.SslCertificateManagedSslCertificate{
+					Domains: []string{"example.com"},
+					DomainStatus: map[string]string{
+						"example.com": domainStatusProvisioning,
+					},
+				},
+			},
+			opts: Options{
+				Now:                 now,
+				ProvisioningTimeout: time.Hour,
+				DomainProvisioningSince: map[string]time.Time{
+					"example.com": now.Add(-2 * time.Hour),
+				},
+			},
+			wantReason: ReasonProvisioningTimeout,
+		},
+		{
+			name: "domain in PROVISIONING but still within the timeout",
+			cert: &compute.SslCertificate{
+				Managed: &compute.SslCertificateManagedSslCertificate{
+					Domains: []string{"example.com"},
+					DomainStatus: map[string]string{
+						"example.com": domainStatusProvisioning,
+					},
+				},
+			},
+			opts: Options{
+				Now:                 now,
+				ProvisioningTimeout: time.Hour,
+				DomainProvisioningSince: map[string]time.Time{
+					"example.com": now.Add(-10 * time.Minute),
+				},
+			},
+			wantEmpty: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := Validate(tc.cert, tc.opts)
+
+			if tc.wantEmpty {
+				if len(errs) != 0 {
+					t.Errorf("Validate() = %v, want no errors", reasons(errs))
+				}
+				return
+			}
+
+			if !hasReason(errs, tc.wantReason) {
+				t.Errorf("Validate() = %v, want it to include %s", reasons(errs), tc.wantReason)
+			}
+		})
+	}
+}
@@ -18,12 +18,14 @@ limitations under the License.
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
 	"time"
 
 	"cloud.google.com/go/compute/metadata"
 	"github.com/golang/glog"
+	ecpClient "github.com/googleapis/enterprise-certificate-proxy/client"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	compute "google.golang.org/api/compute/v0.beta"
@@ -56,12 +58,39 @@ const (
 	sslProvisioningFailed                  = "PROVISIONING_FAILED"
 	sslProvisioningFailedPermanently       = "PROVISIONING_FAILED_PERMANENTLY"
 	sslRenewalFailed                       = "RENEWAL_FAILED"
+
+	// AuthModeDefault uses the mTLS provider when GOOGLE_API_USE_CLIENT_CERTIFICATE is "true";
+	// otherwise it picks the GKE AltTokenSource when a cloud provider config is supplied, and
+	// ADC when none is.
+	AuthModeDefault AuthMode = "default"
+	// AuthModeMTLS forces the mTLS provider, which presents a client certificate held by the
+	// Enterprise Certificate Proxy in a hardware-backed keystore.
+	AuthModeMTLS AuthMode = "mtls"
+
+	envUseClientCertificate = "GOOGLE_API_USE_CLIENT_CERTIFICATE"
+	envCertificateConfig    = "GOOGLE_API_CERTIFICATE_CONFIG"
 )
 
+// AuthMode selects how a TokenSourceProvider obtains its TokenSource. It is set via the
+// --auth-mode flag.
+type AuthMode string
+
+// TokenSourceProvider builds the oauth2.TokenSource and resolves the GCP project ID used
+// to talk to the compute API. tlsConfig is non-nil only for providers that must also present
+// a client certificate, such as mtlsTokenSourceProvider; callers use it to configure the
+// transport their http.Client dials through, not just the TokenSource.
+type TokenSourceProvider interface {
+	TokenSourceAndProjectID() (tokenSource oauth2.TokenSource, projectID string, tlsConfig *tls.Config, err error)
+}
+
 type computeConfig struct {
 	TokenSource oauth2.TokenSource
-	ProjectID   string
-	Timeout     time.Duration
+	// TLSConfig, when non-nil, must be used to configure the transport of any http.Client
+	// built from TokenSource, so a client certificate loaded by an mTLS TokenSourceProvider
+	// is actually presented to the compute API rather than merely held onto.
+	TLSConfig *tls.Config
+	ProjectID string
+	Timeout   time.Duration
 }
 
 type certificateStatusConfig struct {
@@ -80,8 +109,8 @@ type Config struct {
 	SslCertificateNamePrefix string
 }
 
-func New(gceConfigFilePath string) (*Config, error) {
-	tokenSource, projectID, err := getTokenSourceAndProjectID(gceConfigFilePath)
+func New(gceConfigFilePath string, authMode AuthMode) (*Config, error) {
+	tokenSource, projectID, tlsConfig, err := newTokenSourceProvider(gceConfigFilePath, authMode).TokenSourceAndProjectID()
 	if err != nil {
 		return nil, err
 	}
@@ -112,6 +141,7 @@ func New(gceConfigFilePath string) (*Config, error) {
 		},
 		Compute: computeConfig{
 			TokenSource: tokenSource,
+			TLSConfig:   tlsConfig,
 			ProjectID:   projectID,
 			Timeout:     30 * time.Second,
 		},
@@ -119,36 +149,102 @@ func New(gceConfigFilePath string) (*Config, error) {
 	}, nil
 }
 
-func getTokenSourceAndProjectID(gceConfigFilePath string) (oauth2.TokenSource, string, error) {
+// newTokenSourceProvider picks the TokenSourceProvider implementation for authMode,
+// falling back to the env vars GOOGLE_API_USE_CLIENT_CERTIFICATE and
+// GOOGLE_API_CERTIFICATE_CONFIG when authMode is AuthModeDefault, so existing
+// deployments that rely on the env vars alone keep working.
+func newTokenSourceProvider(gceConfigFilePath string, authMode AuthMode) TokenSourceProvider {
+	if authMode == AuthModeMTLS || (authMode == AuthModeDefault || authMode == "") && os.Getenv(envUseClientCertificate) == "true" {
+		return &mtlsTokenSourceProvider{certificateConfigPath: os.Getenv(envCertificateConfig)}
+	}
+
 	if gceConfigFilePath != "" {
-		glog.V(1).Info("In a GKE cluster")
+		return &gkeTokenSourceProvider{gceConfigFilePath: gceConfigFilePath}
+	}
+
+	return &defaultTokenSourceProvider{}
+}
+
+// gkeTokenSourceProvider builds a TokenSource from the cloud provider config mounted into
+// a GKE cluster, the way this controller has always authenticated when run in-cluster.
+type gkeTokenSourceProvider struct {
+	gceConfigFilePath string
+}
 
-		config, err := os.Open(gceConfigFilePath)
-		if err != nil {
-			return nil, "", fmt.Errorf("Could not open cloud provider configuration %s: %v", gceConfigFilePath, err)
-		}
-		defer config.Close()
+func (p *gkeTokenSourceProvider) TokenSourceAndProjectID() (oauth2.TokenSource, string, *tls.Config, error) {
+	glog.V(1).Info("In a GKE cluster")
 
-		var cfg gce.ConfigFile
-		if err := gcfg.ReadInto(&cfg, config); err != nil {
-			return nil, "", fmt.Errorf("Could not read config %v", err)
-		}
-		glog.Infof("Using GCE provider config %+v", cfg)
+	config, err := os.Open(p.gceConfigFilePath)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("Could not open cloud provider configuration %s: %v", p.gceConfigFilePath, err)
+	}
+	defer config.Close()
 
-		return gce.NewAltTokenSource(cfg.Global.TokenURL, cfg.Global.TokenBody), cfg.Global.ProjectID, nil
+	var cfg gce.ConfigFile
+	if err := gcfg.ReadInto(&cfg, config); err != nil {
+		return nil, "", nil, fmt.Errorf("Could not read config %v", err)
 	}
+	glog.Infof("Using GCE provider config %+v", cfg)
 
+	return gce.NewAltTokenSource(cfg.Global.TokenURL, cfg.Global.TokenBody), cfg.Global.ProjectID, nil, nil
+}
+
+// defaultTokenSourceProvider builds a TokenSource from Application Default Credentials,
+// falling back to the metadata server's compute token when none are configured.
+type defaultTokenSourceProvider struct{}
+
+func (p *defaultTokenSourceProvider) TokenSourceAndProjectID() (oauth2.TokenSource, string, *tls.Config, error) {
 	projectID, err := metadata.ProjectID()
 	if err != nil {
-		return nil, "", fmt.Errorf("Could not fetch project id: %v", err)
+		return nil, "", nil, fmt.Errorf("Could not fetch project id: %v", err)
 	}
 
 	if len(os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")) > 0 {
 		glog.V(1).Info("In a GCP cluster")
 		tokenSource, err := google.DefaultTokenSource(oauth2.NoContext, compute.ComputeScope)
-		return tokenSource, projectID, err
-	} else {
-		glog.V(1).Info("Using default TokenSource")
-		return google.ComputeTokenSource(""), projectID, nil
+		return tokenSource, projectID, nil, err
+	}
+
+	glog.V(1).Info("Using default TokenSource")
+	return google.ComputeTokenSource(""), projectID, nil, nil
+}
+
+// mtlsTokenSourceProvider pairs a TokenSource from Application Default Credentials with a
+// tls.Config whose client certificate comes from the Enterprise Certificate Proxy, so that
+// certificate's private key stays inside an OS keystore. The TokenSource itself is not derived
+// from that certificate; it is the same ADC TokenSource google.DefaultTokenSource returns.
+// certificateConfigPath points at an ECP config file naming the keystore helper binary to
+// shell out to for signing. The returned tls.Config must be wired into the transport of any
+// http.Client the caller builds from the TokenSource, or the loaded certificate is never
+// actually presented to the compute API.
+type mtlsTokenSourceProvider struct {
+	certificateConfigPath string
+}
+
+func (p *mtlsTokenSourceProvider) TokenSourceAndProjectID() (oauth2.TokenSource, string, *tls.Config, error) {
+	glog.V(1).Info("Using Enterprise Certificate Proxy TokenSource")
+
+	projectID, err := metadata.ProjectID()
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("Could not fetch project id: %v", err)
+	}
+
+	key, err := ecpClient.Cred(p.certificateConfigPath)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("Could not load enterprise certificate config %s: %v", p.certificateConfigPath, err)
+	}
+
+	tlsConfig := &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return key.TLSCertificate(), nil
+		},
 	}
+
+	tokenSource, err := google.DefaultTokenSource(oauth2.NoContext, compute.ComputeScope)
+	if err != nil {
+		key.Close()
+		return nil, "", nil, err
+	}
+
+	return tokenSource, projectID, tlsConfig, nil
 }
@@ -18,15 +18,30 @@ package controller
 
 import (
 	"fmt"
+	"reflect"
+	"time"
 
 	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/cache"
 
+	apisv1 "github.com/GoogleCloudPlatform/gke-managed-certs/pkg/apis/networking.gke.io/v1"
+	"github.com/GoogleCloudPlatform/gke-managed-certs/pkg/config"
 	"github.com/GoogleCloudPlatform/gke-managed-certs/pkg/utils/types"
 )
 
+// expiringSoonThreshold is how far ahead of an SslCertificate's ExpireTime we start
+// warning that it is approaching expiration.
+const expiringSoonThreshold = 30 * 24 * time.Hour
+
+const (
+	expiryBucketExpired      = "expired"
+	expiryBucketWithin7Days  = "7d"
+	expiryBucketWithin30Days = "30d"
+)
+
 func (c *controller) enqueue(obj interface{}) {
 	key, err := cache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -62,19 +77,137 @@ func (c *controller) enqueueAll() {
 	}
 
 	c.metrics.ObserveManagedCertificatesStatuses(statuses)
+
+	c.monitorCertificateExpirations(mcrts)
+}
+
+// monitorCertificateExpirations fetches the backing SslCertificate for each of mcrts and
+// reports its expiration as Prometheus metrics, bucketing certificates into "expired", "7d",
+// "30d" and healthy (>30d, not reported), and logging a warning for any certificate outside
+// the healthy bucket. It is called from enqueueAll with the list enqueueAll already fetched,
+// so it runs on the same periodic resync as the rest of that loop without re-listing.
+func (c *controller) monitorCertificateExpirations(mcrts []*apisv1.ManagedCertificate) {
+	now := time.Now()
+	bucketCounts := map[string]int{
+		expiryBucketExpired:      0,
+		expiryBucketWithin7Days:  0,
+		expiryBucketWithin30Days: 0,
+	}
+
+	for _, mcrt := range mcrts {
+		sslCertificateName := config.SslCertificateNamePrefix + mcrt.Name
+		if activeSslCertificateName, ok := mcrt.Annotations[refreshActiveNameAnnotation]; ok && activeSslCertificateName != "" {
+			sslCertificateName = activeSslCertificateName
+		}
+
+		sslCertificate, err := c.ssl.Get(sslCertificateName)
+		if err != nil {
+			glog.Warningf("Could not fetch SslCertificate %s for ManagedCertificate %s/%s: %v",
+				sslCertificateName, mcrt.Namespace, mcrt.Name, err)
+			continue
+		}
+
+		if sslCertificate.ExpireTime == "" {
+			continue
+		}
+
+		expireTime, err := time.Parse(time.RFC3339, sslCertificate.ExpireTime)
+		if err != nil {
+			glog.Warningf("Could not parse ExpireTime %q of SslCertificate %s: %v",
+				sslCertificate.ExpireTime, sslCertificateName, err)
+			continue
+		}
+
+		for _, domain := range mcrt.Spec.Domains {
+			c.metrics.ObserveCertificateExpiry(mcrt.Namespace, mcrt.Name, domain, expireTime)
+		}
+
+		timeLeft := expireTime.Sub(now)
+		switch {
+		case timeLeft <= 0:
+			glog.Warningf("SslCertificate %s for ManagedCertificate %s/%s has already expired",
+				sslCertificateName, mcrt.Namespace, mcrt.Name)
+			bucketCounts[expiryBucketExpired]++
+		case timeLeft <= 7*24*time.Hour:
+			glog.Warningf("SslCertificate %s for ManagedCertificate %s/%s expires in %s",
+				sslCertificateName, mcrt.Namespace, mcrt.Name, timeLeft)
+			bucketCounts[expiryBucketWithin7Days]++
+		case timeLeft <= expiringSoonThreshold:
+			glog.Warningf("SslCertificate %s for ManagedCertificate %s/%s expires in %s",
+				sslCertificateName, mcrt.Namespace, mcrt.Name, timeLeft)
+			bucketCounts[expiryBucketWithin30Days]++
+		}
+	}
+
+	for threshold, count := range bucketCounts {
+		c.metrics.ObserveCertificatesExpiringSoon(threshold, count)
+	}
 }
 
+// handle drives a refresh (if any is requested) and the regular sync for the named
+// ManagedCertificate. A refresh error is reported but does not block the sync: the two are
+// independent, and a certificate stuck on a failing refresh must still get its regular
+// status/creation sync.
 func (c *controller) handle(key string) error {
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		return err
 	}
 
+	refreshErr := c.handleRefresh(namespace, name)
+
 	if err := c.sync.ManagedCertificate(types.NewCertId(namespace, name)); err != nil {
+		if refreshErr != nil {
+			// Both failed for this reconcile; handleRefresh already logged refreshErr with its
+			// own context, but report it here too so it isn't lost under the sync error this
+			// call actually returns.
+			runtime.HandleError(refreshErr)
+		}
 		return err
 	}
 
-	return err
+	return refreshErr
+}
+
+// handleRefresh drives maybeRefreshCertificate for the named ManagedCertificate ahead of the
+// regular sync, persisting any annotation changes it makes. A ManagedCertificate without
+// refreshAnnotation set is a no-op.
+func (c *controller) handleRefresh(namespace, name string) error {
+	mcrt, err := c.lister.ManagedCertificates(namespace).Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	if _, ok := mcrt.Annotations[refreshAnnotation]; !ok {
+		return nil
+	}
+
+	updated := mcrt.DeepCopy()
+	currentSslCertificateName := config.SslCertificateNamePrefix + mcrt.Name
+
+	activeSslCertificateName, refreshErr := c.maybeRefreshCertificate(updated, currentSslCertificateName, mcrt.Spec.Domains)
+	if refreshErr != nil {
+		glog.Warningf("Could not refresh SslCertificate for ManagedCertificate %s/%s: %v", namespace, name, refreshErr)
+	}
+
+	// refreshActiveNameAnnotation is the SslCertificate name whatever attaches a certificate
+	// to the Ingress/TargetHttpsProxy should be using; it's kept up to date independently of
+	// whether the refresh succeeded so a failed attempt never leaves it stale.
+	setAnnotation(updated, refreshActiveNameAnnotation, activeSslCertificateName)
+
+	if !reflect.DeepEqual(mcrt.Annotations, updated.Annotations) {
+		if _, err := c.client.NetworkingV1().ManagedCertificates(namespace).Update(updated); err != nil {
+			return err
+		}
+	}
+
+	// Surface a transient refresh error to the caller so the rate-limited queue retries this
+	// ManagedCertificate, instead of silently leaving it stuck at whatever state was persisted
+	// above.
+	return refreshErr
 }
 
 func (c *controller) processNextManagedCertificate() {
@@ -0,0 +1,161 @@
+/*
+Copyright 2018 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	apisv1 "github.com/GoogleCloudPlatform/gke-managed-certs/pkg/apis/networking.gke.io/v1"
+	"github.com/GoogleCloudPlatform/gke-managed-certs/pkg/config"
+)
+
+const (
+	// refreshAnnotation, when present on a ManagedCertificate, requests that its backing
+	// SslCertificate be deleted and recreated under a new name.
+	refreshAnnotation = "networking.gke.io/refresh-certificate"
+	// refreshStatusAnnotation tracks the progress of a refresh requested via refreshAnnotation.
+	// It holds exactly one of the refreshStatus* values below, never anything else, so callers
+	// can compare it for equality.
+	refreshStatusAnnotation = "networking.gke.io/refresh-certificate-status"
+	// refreshNewNameAnnotation holds the name of the SslCertificate created to replace the
+	// previous one, from the moment it's created; it is left in place once the refresh is done
+	// or has failed.
+	refreshNewNameAnnotation = "networking.gke.io/refresh-new-name"
+	// refreshPreviousNameAnnotation holds the name of the SslCertificate the refresh is
+	// replacing, kept around so a failed refresh can roll back to it.
+	refreshPreviousNameAnnotation = "networking.gke.io/refresh-previous-name"
+	// refreshExpiresAtAnnotation is set to the new SslCertificate's real ExpireTime once the
+	// refresh completes; it is never a guessed or derived timestamp.
+	refreshExpiresAtAnnotation = "networking.gke.io/refresh-expires-at"
+	// refreshActiveNameAnnotation records the SslCertificate name that should currently be
+	// attached to the Ingress: the previous one while a refresh is in progress, the new one
+	// once it's done.
+	refreshActiveNameAnnotation = "networking.gke.io/refresh-active-name"
+
+	refreshStatusInProgress = "in-progress"
+	refreshStatusDone       = "done"
+	refreshStatusFailed     = "failed"
+
+	sslCertificateStatusActive                        = "ACTIVE"
+	sslCertificateStatusProvisioningFailedPermanently = "PROVISIONING_FAILED_PERMANENTLY"
+)
+
+// maybeRefreshCertificate inspects mcrt for refreshAnnotation and drives the refresh state
+// machine tracked via refreshStatusAnnotation:
+//
+//   - absent/unset: a new SslCertificate is created for domains and its name recorded, while
+//     currentSslCertificateName keeps serving traffic.
+//   - in-progress: the new SslCertificate's status is polled; once it reaches ACTIVE, the old
+//     one is deleted and the refresh is marked done; if it reaches PROVISIONING_FAILED_PERMANENTLY,
+//     the refresh is marked failed. Until then currentSslCertificateName is
+//     returned unchanged, so a slow or stuck provision never interrupts serving traffic.
+//   - done/failed: terminal, no-op.
+//
+// The returned string is the SslCertificate name that should currently be referenced by the
+// Ingress. mcrt's annotations are updated in place; callers are responsible for persisting it.
+func (c *controller) maybeRefreshCertificate(mcrt *apisv1.ManagedCertificate, currentSslCertificateName string, domains []string) (string, error) {
+	if _, ok := mcrt.Annotations[refreshAnnotation]; !ok {
+		return currentSslCertificateName, nil
+	}
+
+	switch mcrt.Annotations[refreshStatusAnnotation] {
+	case refreshStatusDone:
+		if newSslCertificateName := mcrt.Annotations[refreshNewNameAnnotation]; newSslCertificateName != "" {
+			return newSslCertificateName, nil
+		}
+		return currentSslCertificateName, nil
+	case refreshStatusFailed:
+		return currentSslCertificateName, nil
+	case refreshStatusInProgress:
+		return c.continueRefresh(mcrt, currentSslCertificateName)
+	default:
+		return c.startRefresh(mcrt, currentSslCertificateName, domains)
+	}
+}
+
+// startRefresh creates the replacement SslCertificate and records it as in-progress.
+// previousSslCertificateName keeps serving traffic until continueRefresh sees the new one
+// become ACTIVE. A Create failure is left unmarked rather than recorded as refreshStatusFailed,
+// since refreshStatusFailed is a terminal state maybeRefreshCertificate never retries from, and
+// a single Create error (quota, transient 5xx) isn't grounds to stop retrying permanently; the
+// caller sees the returned error and tries again on the next reconcile.
+func (c *controller) startRefresh(mcrt *apisv1.ManagedCertificate, previousSslCertificateName string, domains []string) (string, error) {
+	newSslCertificateName := fmt.Sprintf("%s%s-refresh-%d", config.SslCertificateNamePrefix, mcrt.Name, time.Now().Unix())
+
+	if err := c.ssl.Create(newSslCertificateName, domains); err != nil {
+		return previousSslCertificateName, err
+	}
+
+	setAnnotation(mcrt, refreshStatusAnnotation, refreshStatusInProgress)
+	setAnnotation(mcrt, refreshNewNameAnnotation, newSslCertificateName)
+	setAnnotation(mcrt, refreshPreviousNameAnnotation, previousSslCertificateName)
+
+	return previousSslCertificateName, nil
+}
+
+// continueRefresh checks whether the in-progress SslCertificate has become ACTIVE. Until it
+// has, the previous SslCertificate keeps serving so rollback stays possible; once it has, the
+// previous one is deleted and the refresh is marked done with the new certificate's real
+// ExpireTime. If the new SslCertificate fails provisioning permanently, the refresh is marked
+// failed and the previous SslCertificate stays in use.
+func (c *controller) continueRefresh(mcrt *apisv1.ManagedCertificate, previousSslCertificateName string) (string, error) {
+	newSslCertificateName := mcrt.Annotations[refreshNewNameAnnotation]
+
+	newSslCertificate, err := c.ssl.Get(newSslCertificateName)
+	if err != nil {
+		return previousSslCertificateName, err
+	}
+
+	var status string
+	if newSslCertificate.Managed != nil {
+		status = newSslCertificate.Managed.Status
+	}
+
+	if status == sslCertificateStatusProvisioningFailedPermanently {
+		glog.Warningf("SslCertificate %s for ManagedCertificate %s/%s failed provisioning permanently, keeping %s",
+			newSslCertificateName, mcrt.Namespace, mcrt.Name, previousSslCertificateName)
+		setAnnotation(mcrt, refreshStatusAnnotation, refreshStatusFailed)
+		return previousSslCertificateName, nil
+	}
+
+	if status != sslCertificateStatusActive {
+		glog.V(1).Infof("SslCertificate %s for ManagedCertificate %s/%s is still %s, not yet refreshing from %s",
+			newSslCertificateName, mcrt.Namespace, mcrt.Name, status, previousSslCertificateName)
+		return previousSslCertificateName, nil
+	}
+
+	if err := c.ssl.Delete(previousSslCertificateName); err != nil {
+		glog.Warningf("Could not delete previous SslCertificate %s while refreshing ManagedCertificate %s/%s, keeping it around for rollback: %v",
+			previousSslCertificateName, mcrt.Namespace, mcrt.Name, err)
+		return previousSslCertificateName, err
+	}
+
+	setAnnotation(mcrt, refreshStatusAnnotation, refreshStatusDone)
+	setAnnotation(mcrt, refreshExpiresAtAnnotation, newSslCertificate.ExpireTime)
+
+	return newSslCertificateName, nil
+}
+
+func setAnnotation(mcrt *apisv1.ManagedCertificate, key, value string) {
+	if mcrt.Annotations == nil {
+		mcrt.Annotations = make(map[string]string)
+	}
+	mcrt.Annotations[key] = value
+}